@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// cacheTodayTTL bounds how long today's quote is trusted from cache: CBR
+// may not have published the current day's rate yet, so a fresh download
+// is preferred once the cached copy goes stale.
+const cacheTodayTTL = 1 * time.Hour
+
+// xmlCache is a filesystem cache of raw CBR daily XML, keyed by date. A
+// nil *xmlCache or one with Disabled set behaves as if caching were off.
+type xmlCache struct {
+	Dir      string
+	Disabled bool
+}
+
+func newXMLCache(dir string, disabled bool) *xmlCache {
+	return &xmlCache{Dir: dir, Disabled: disabled}
+}
+
+// defaultCacheDir returns "~/.cache/cbrtest", falling back to a relative
+// ".cbrtest-cache" if the user cache directory can't be determined.
+func defaultCacheDir() string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return ".cbrtest-cache"
+	}
+	return filepath.Join(base, "cbrtest")
+}
+
+func (c *xmlCache) path(date string) (string, error) {
+	parsed, err := time.Parse(cbrDateLayout, date)
+	if err != nil {
+		return "", fmt.Errorf("ошибка разбора даты %s: %w", date, err)
+	}
+	return filepath.Join(c.Dir, parsed.Format("2006-01-02")+".xml"), nil
+}
+
+// load returns the cached XML for date, if present, fresh enough, and
+// structurally valid.
+func (c *xmlCache) load(date string) ([]byte, bool) {
+	if c == nil || c.Disabled {
+		return nil, false
+	}
+
+	path, err := c.path(date)
+	if err != nil {
+		return nil, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+
+	if isToday(date) && time.Since(info.ModTime()) > cacheTodayTTL {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	if !isValidCBRXML(data) {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// store persists data as the cached XML for date, best-effort: a failure
+// to write the cache should not fail the overall fetch.
+func (c *xmlCache) store(date string, data []byte) {
+	if c == nil || c.Disabled {
+		return
+	}
+
+	path, err := c.path(date)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+
+	_ = os.WriteFile(path, data, 0o644)
+}
+
+func isToday(date string) bool {
+	parsed, err := time.Parse(cbrDateLayout, date)
+	if err != nil {
+		return false
+	}
+	return parsed.Format("2006-01-02") == time.Now().Format("2006-01-02")
+}
+
+// isValidCBRXML does a cheap integrity check on cached data: non-empty
+// and rooted at the expected ValCurs element.
+func isValidCBRXML(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.ToLower(charset) == "windows-1251" {
+			return charmap.Windows1251.NewDecoder().Reader(input), nil
+		}
+		return input, nil
+	}
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local == "ValCurs"
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+func main() {
+	initLogger()
+	defer logger.Sync()
+
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "fetch":
+		runFetch(os.Args[2:])
+	case "report":
+		runReport(os.Args[2:])
+	case "export":
+		runExport(os.Args[2:])
+	case "serve":
+		runServe(os.Args[2:])
+	default:
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Println("использование: cbrtest <fetch|report|export|serve> [флаги]")
+}
+
+// runFetch populates the database with any requested dates it doesn't
+// already have, downloading only the gap via the worker-pool fetch engine.
+func runFetch(args []string) {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	dbPath := fs.String("db", defaultDBPath(), "path to the sqlite database")
+	cacheDir := fs.String("cache-dir", defaultCacheDir(), "directory for cached CBR daily XML")
+	noCache := fs.Bool("no-cache", false, "bypass the on-disk XML cache")
+	days := fs.Int("days", REPORT_DAYS, "how many days back to fetch")
+	fs.Parse(args)
+
+	db, err := openDB(*dbPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	dates := generateDates(*days)
+	missing, err := missingDates(db, dates)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if len(missing) == 0 {
+		fmt.Println("Все даты уже присутствуют в базе данных.")
+		return
+	}
+
+	logger.Info("загрузка новых дат", zap.Int("missing", len(missing)), zap.Int("requested", len(dates)))
+
+	ctx := context.Background()
+	limiter := rate.NewLimiter(rate.Every(REQUEST_RATE), 1)
+	cache := newXMLCache(*cacheDir, *noCache)
+	results := fetchAll(ctx, missing, WORKER_COUNT, limiter, cache)
+
+	var newRecords []CurrencyRecord
+	successDays := 0
+	for i, res := range results {
+		logger.Info("обработка дня", zap.Int("day", i+1), zap.Int("total", len(results)), zap.String("date", res.date))
+		if res.err != nil {
+			logger.Warn("ошибка загрузки дня", zap.String("date", res.date), zap.Error(res.err))
+			continue
+		}
+		successDays++
+		newRecords = append(newRecords, res.records...)
+	}
+
+	if len(newRecords) == 0 {
+		fmt.Println("Не удалось загрузить новые данные.")
+		return
+	}
+
+	if err := saveRecords(db, newRecords); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Сохранено %d новых записей за %d дней.\n", len(newRecords), successDays)
+}
+
+func runReport(args []string) {
+	renderFromDB("report", args, "text")
+}
+
+func runExport(args []string) {
+	renderFromDB("export", args, "csv")
+}
+
+// renderFromDB implements both the report and export subcommands: load
+// matching records from the database, aggregate them, and render through
+// the Reporter subsystem. defaultFormat lets report default to a
+// human-readable table while export defaults to a machine-friendly one.
+func renderFromDB(name string, args []string, defaultFormat string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dbPath := fs.String("db", defaultDBPath(), "path to the sqlite database")
+	from := fs.String("from", "", "начальная дата фильтра (DD/MM/YYYY)")
+	to := fs.String("to", "", "конечная дата фильтра (DD/MM/YYYY)")
+	code := fs.String("code", "", "код валюты (пусто — все валюты)")
+	base := fs.String("base", defaultBaseCurrency, "базовая валюта для кросс-курса (по умолчанию RUB)")
+	format := fs.String("format", defaultFormat, "формат отчета: text, json, csv или xlsx")
+	output := fs.String("output", "", "путь к файлу отчета (по умолчанию — stdout; обязателен для xlsx)")
+	fs.Parse(args)
+
+	reporter, err := newReporter(*format)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	db, err := openDB(*dbPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	records, err := queryRecords(db, *from, *to, *code)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if len(records) == 0 {
+		fmt.Println("Нет данных, соответствующих заданным фильтрам.")
+		return
+	}
+
+	// The base currency's own rate is needed to compute cross-rates even
+	// when --code filters records down to a different currency, so load
+	// it separately rather than relying on it being present in records.
+	baseRecords := records
+	if *code != "" && !strings.EqualFold(*code, normalizeBase(*base)) {
+		baseRecords, err = queryRecords(db, *from, *to, normalizeBase(*base))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	data := aggregateReport(crossRate(records, baseRecords, *base), *base)
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Printf("ошибка создания файла отчета %s: %v\n", *output, err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		w = file
+	} else if *format == "xlsx" {
+		fmt.Println("формат xlsx требует флаг --output")
+		os.Exit(1)
+	}
+
+	if err := reporter.Report(data, w); err != nil {
+		fmt.Printf("ошибка формирования отчета: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// defaultBaseCurrency is CBR's native quotation currency: every
+// CurrencyRecord.Value is naturally expressed as RUB per unit.
+const defaultBaseCurrency = "RUB"
+
+// crossRate re-expresses records, which are all RUB-per-unit as fetched
+// from CBR, in base-per-target terms: for each date it divides every
+// record's value by the base currency's RUB rate on that same date.
+// baseRates supplies the base currency's own RUB rate per date; pass
+// records itself unless the caller has filtered records down to a subset
+// of currencies (e.g. by code) that may not include the base currency's
+// rows. If base is empty or RUB, records are returned unchanged. A date
+// missing the base currency's rate is dropped from the result with a
+// warning, since no cross-rate can be computed for it.
+func crossRate(records, baseRates []CurrencyRecord, base string) []CurrencyRecord {
+	if base == "" || strings.EqualFold(base, defaultBaseCurrency) {
+		return records
+	}
+
+	baseRateByDate := make(map[string]float64, len(baseRates))
+	for _, r := range baseRates {
+		if strings.EqualFold(r.Code, base) {
+			baseRateByDate[r.Date] = r.Value
+		}
+	}
+
+	result := make([]CurrencyRecord, 0, len(records))
+	warned := make(map[string]bool)
+
+	for _, r := range records {
+		baseRate, ok := baseRateByDate[r.Date]
+		if !ok {
+			if !warned[r.Date] {
+				logger.Warn("базовая валюта отсутствует на дату, дата пропущена",
+					zap.String("date", r.Date), zap.String("base", base))
+				warned[r.Date] = true
+			}
+			continue
+		}
+
+		transformed := r
+		transformed.Value = r.Value / baseRate
+		result = append(result, transformed)
+	}
+
+	return result
+}
+
+// normalizeBase returns the display form of a --base flag value,
+// defaulting an empty value to the native RUB quotation.
+func normalizeBase(base string) string {
+	if base == "" {
+		return defaultBaseCurrency
+	}
+	return strings.ToUpper(base)
+}
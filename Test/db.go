@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultDBPath returns "~/.cache/cbrtest/cbrtest.db", falling back to a
+// relative path if the user cache directory can't be determined.
+func defaultDBPath() string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "cbrtest.db"
+	}
+	return filepath.Join(base, "cbrtest", "cbrtest.db")
+}
+
+// openDB opens (creating if necessary) the sqlite database at path and
+// migrates it to the current CurrencyRecord schema.
+func openDB(path string) (*gorm.DB, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("ошибка создания директории базы данных %s: %w", dir, err)
+		}
+	}
+
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия базы данных %s: %w", path, err)
+	}
+
+	if err := db.AutoMigrate(&CurrencyRecord{}); err != nil {
+		return nil, fmt.Errorf("ошибка миграции схемы: %w", err)
+	}
+
+	return db, nil
+}
+
+// missingDates returns the subset of dates not yet present in the
+// database, so a fetch run only downloads what it doesn't already have.
+func missingDates(db *gorm.DB, dates []string) ([]string, error) {
+	var existing []string
+	if err := db.Model(&CurrencyRecord{}).Distinct().Pluck("date", &existing).Error; err != nil {
+		return nil, fmt.Errorf("ошибка чтения имеющихся дат: %w", err)
+	}
+
+	have := make(map[string]bool, len(existing))
+	for _, d := range existing {
+		have[d] = true
+	}
+
+	var missing []string
+	for _, d := range dates {
+		if !have[d] {
+			missing = append(missing, d)
+		}
+	}
+	return missing, nil
+}
+
+// saveRecords inserts records, silently skipping any that already exist
+// for their (Date, Code) pair.
+func saveRecords(db *gorm.DB, records []CurrencyRecord) error {
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error; err != nil {
+		return fmt.Errorf("ошибка записи в базу данных: %w", err)
+	}
+	return nil
+}
+
+// recordKey uniquely identifies a CurrencyRecord by its (Date, Code)
+// pair, matching the database's unique index.
+func recordKey(r CurrencyRecord) string {
+	return r.Date + "|" + r.Code
+}
+
+// existingRecordKeys returns the (Date, Code) keys already stored for
+// dates, so a caller can tell which freshly-fetched records are actually
+// new after a bulk upsert.
+func existingRecordKeys(db *gorm.DB, dates []string) (map[string]bool, error) {
+	var rows []CurrencyRecord
+	if err := db.Select("date", "code").Where("date IN ?", dates).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("ошибка чтения имеющихся записей: %w", err)
+	}
+
+	keys := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		keys[recordKey(r)] = true
+	}
+	return keys, nil
+}
+
+// queryRecords loads records from the database, optionally filtered by
+// currency code and by a [from, to] date range (either bound may be
+// empty). Dates are stored in CBR's native DD/MM/YYYY form, so the range
+// is applied in Go rather than as a lexical SQL comparison.
+func queryRecords(db *gorm.DB, from, to, code string) ([]CurrencyRecord, error) {
+	query := db.Model(&CurrencyRecord{})
+	if code != "" {
+		query = query.Where("code = ?", code)
+	}
+
+	var records []CurrencyRecord
+	if err := query.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("ошибка чтения записей: %w", err)
+	}
+
+	if from == "" && to == "" {
+		return records, nil
+	}
+
+	fromTime, toTime, err := parseDateRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := records[:0]
+	for _, r := range records {
+		t, err := time.Parse(cbrDateLayout, r.Date)
+		if err != nil {
+			continue
+		}
+		if !fromTime.IsZero() && t.Before(fromTime) {
+			continue
+		}
+		if !toTime.IsZero() && t.After(toTime) {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+	return filtered, nil
+}
+
+func parseDateRange(from, to string) (time.Time, time.Time, error) {
+	var fromTime, toTime time.Time
+	var err error
+
+	if from != "" {
+		fromTime, err = time.Parse(cbrDateLayout, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("ошибка разбора --from %s: %w", from, err)
+		}
+	}
+	if to != "" {
+		toTime, err = time.Parse(cbrDateLayout, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("ошибка разбора --to %s: %w", to, err)
+		}
+	}
+	return fromTime, toTime, nil
+}
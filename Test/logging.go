@@ -0,0 +1,16 @@
+package main
+
+import "go.uber.org/zap"
+
+// logger carries structured progress and error logs, replacing the
+// original ad-hoc fmt.Printf progress lines so the fetcher can run as a
+// long-lived scraper with parseable output.
+var logger *zap.Logger
+
+func initLogger() {
+	l, err := zap.NewProduction()
+	if err != nil {
+		l = zap.NewNop()
+	}
+	logger = l
+}
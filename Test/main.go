@@ -2,121 +2,187 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/time/rate"
 )
 
 type CurrencyRecord struct {
-	Date  string
-	Code  string
-	Name  string
-	Value float64
+	ID    uint    `json:"-" gorm:"primaryKey"`
+	Date  string  `json:"date" gorm:"uniqueIndex:idx_date_code"`
+	Code  string  `json:"code" gorm:"uniqueIndex:idx_date_code"`
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
 }
 
 type CurrencyAggregator struct {
-	Name  string
-	Sum   float64
-	Count int
+	Name  string  `json:"name"`
+	Sum   float64 `json:"sum"`
+	Count int     `json:"count"`
 }
 
 const (
-	CBR_URL        = "http://www.cbr.ru/scripts/XML_daily_eng.asp?date_req=%s"
-	REPORT_DAYS    = 90
-	API_CALL_DELAY = 100 * time.Millisecond
+	CBR_URL          = "http://www.cbr.ru/scripts/XML_daily_eng.asp?date_req=%s"
+	REPORT_DAYS      = 90
+	WORKER_COUNT     = 8
+	REQUEST_RATE     = 10 * time.Millisecond // min interval between requests across all workers
+	REQUEST_TIMEOUT  = 10 * time.Second
+	MAX_RETRIES      = 3
+	RETRY_BASE_DELAY = 200 * time.Millisecond
+
+	cbrDateLayout = "02/01/2006"
 )
 
-func main() {
-	days := REPORT_DAYS
-	fmt.Printf("Отчет по курсам валют ЦБ РФ за последние %d дней.\n", days)
-
-	currencyStats := make(map[string]CurrencyAggregator)
-
-	var maxRecord, minRecord CurrencyRecord
-	hasRecords := false
+// httpStatusError records a non-2xx HTTP response so callers can decide
+// whether it is worth retrying.
+type httpStatusError struct {
+	StatusCode int
+	URL        string
+}
 
-	dates := generateDates(days)
-	successDays := 0
-	totalCurrencyRecords := 0
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("неудачный HTTP статус: %d для %s", e.StatusCode, e.URL)
+}
 
-	for i, dateStr := range dates {
-		fmt.Printf("Processing day %d/%d...\n", i+1, len(dates))
-		data, err := getCurrencyData(dateStr)
-		if err != nil {
-			continue
-		}
+// fetchResult carries the outcome of fetching a single date, tagged with
+// its position in the requested date range so results can be reduced in
+// the original, deterministic order regardless of which worker finished it.
+type fetchResult struct {
+	index   int
+	date    string
+	records []CurrencyRecord
+	err     error
+}
 
-		successDays++
-		totalCurrencyRecords += len(data)
-
-		for _, record := range data {
-			if stats, exists := currencyStats[record.Code]; exists {
-				stats.Sum += record.Value
-				stats.Count++
-				currencyStats[record.Code] = stats
-			} else {
-				currencyStats[record.Code] = CurrencyAggregator{
-					Name:  record.Name,
-					Sum:   record.Value,
-					Count: 1,
-				}
+// fetchAll dispatches one job per date to a fixed pool of workers, all
+// sharing limiter to cap the aggregate request rate against CBR. A single
+// reducer goroutine collects results keyed by their original index so the
+// returned slice preserves the input date order, independent of worker
+// scheduling.
+func fetchAll(ctx context.Context, dates []string, workers int, limiter *rate.Limiter, cache *xmlCache) []fetchResult {
+	jobs := make(chan int)
+	resultsCh := make(chan fetchResult)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				records, err := fetchWithRetry(ctx, limiter, dates[i], cache)
+				resultsCh <- fetchResult{index: i, date: dates[i], records: records, err: err}
 			}
+		}()
+	}
 
-			if !hasRecords || record.Value > maxRecord.Value {
-				maxRecord = record
-			}
-			if !hasRecords || record.Value < minRecord.Value {
-				minRecord = record
+	go func() {
+		defer close(jobs)
+		for i := range dates {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
 			}
-			hasRecords = true
 		}
+	}()
 
-		time.Sleep(API_CALL_DELAY)
-	}
+	go func() {
+		wg.Wait()
+		close(resultsCh)
+	}()
 
-	if !hasRecords {
-		fmt.Println("Не удалось загрузить данные за указанный период.")
-		return
+	ordered := make([]fetchResult, len(dates))
+	for res := range resultsCh {
+		ordered[res.index] = res
 	}
+	return ordered
+}
 
-	fmt.Printf("Обработано всего %d записей о курсах.\n", totalCurrencyRecords)
+// fetchWithRetry calls getCurrencyData, retrying transient failures (5xx
+// responses and network errors) with exponential backoff. Non-transient
+// errors are returned immediately.
+func fetchWithRetry(ctx context.Context, limiter *rate.Limiter, date string, cache *xmlCache) ([]CurrencyRecord, error) {
+	var lastErr error
 
-	fmt.Printf("Максимальный курс: %.4f руб. за 1 %s (%s)\n",
-		maxRecord.Value, maxRecord.Code, maxRecord.Name)
-	fmt.Printf("Дата фиксации: %s\n", maxRecord.Date)
+	for attempt := 0; attempt <= MAX_RETRIES; attempt++ {
+		if data, ok := cache.load(date); ok {
+			return parseCurrencyXML(data, date)
+		}
 
-	fmt.Printf("Минимальный курс: %.4f руб. за 1 %s (%s)\n",
-		minRecord.Value, minRecord.Code, minRecord.Name)
-	fmt.Printf("Дата фиксации: %s\n", minRecord.Date)
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
 
-	fmt.Printf("Количество уникальных валют: %d\n", len(currencyStats))
+		reqCtx, cancel := context.WithTimeout(ctx, REQUEST_TIMEOUT)
+		records, err := getCurrencyData(reqCtx, date, cache)
+		cancel()
 
-	fmt.Printf("%-6s %-30s %15s\n", "Код", "Название Валюты", "Средний Курс (руб.)")
-	fmt.Println(strings.Repeat("-", 53))
+		if err == nil {
+			return records, nil
+		}
+		lastErr = err
 
-	for code, stats := range currencyStats {
-		average := stats.Sum / float64(stats.Count)
-		fmt.Printf("%-6s %-30s %15.4f\n", code, stats.Name, average)
+		if !isRetryableError(err) || attempt == MAX_RETRIES {
+			return nil, err
+		}
+
+		delay := RETRY_BASE_DELAY * time.Duration(1<<uint(attempt))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, lastErr
+}
+
+// isRetryableError reports whether err represents a transient failure
+// worth retrying: a 5xx HTTP status or a network-level error.
+func isRetryableError(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
 	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
 }
 
-func getCurrencyData(date string) ([]CurrencyRecord, error) {
+// getCurrencyData fetches the CBR daily XML for date over HTTP, caching
+// the raw response in cache for subsequent runs, and parses it. Each
+// call is instrumented with cbr_requests_total, cbr_request_duration_seconds
+// and the per-currency cbr_rate gauges.
+func getCurrencyData(ctx context.Context, date string, cache *xmlCache) (records []CurrencyRecord, err error) {
+	start := time.Now()
+	defer func() { observeFetch(date, start, records, err) }()
+
 	url := fmt.Sprintf(CBR_URL, date)
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса к %s: %w", url, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка HTTP запроса к %s: %w", url, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("неудачный HTTP статус: %d для даты %s", resp.StatusCode, date)
+		return nil, &httpStatusError{StatusCode: resp.StatusCode, URL: url}
 	}
 
 	data, err := io.ReadAll(resp.Body)
@@ -124,6 +190,14 @@ func getCurrencyData(date string) ([]CurrencyRecord, error) {
 		return nil, fmt.Errorf("ошибка чтения ответа: %w", err)
 	}
 
+	cache.store(date, data)
+
+	return parseCurrencyXML(data, date)
+}
+
+// parseCurrencyXML decodes raw CBR daily XML (as returned live or read
+// from cache) into CurrencyRecord values for date.
+func parseCurrencyXML(data []byte, date string) ([]CurrencyRecord, error) {
 	var xmlData struct {
 		XMLName xml.Name `xml:"ValCurs"`
 		Valutes []struct {
@@ -142,8 +216,7 @@ func getCurrencyData(date string) ([]CurrencyRecord, error) {
 		return input, nil
 	}
 
-	err = decoder.Decode(&xmlData)
-	if err != nil {
+	if err := decoder.Decode(&xmlData); err != nil {
 		return nil, fmt.Errorf("ошибка декодирования XML: %w", err)
 	}
 
@@ -182,7 +255,7 @@ func generateDates(days int) []string {
 	now := time.Now()
 	for i := 0; i < days; i++ {
 		date := now.Add(-time.Duration(i) * 24 * time.Hour)
-		dates = append(dates, date.Format("02/01/2006"))
+		dates = append(dates, date.Format(cbrDateLayout))
 	}
 	return dates
 }
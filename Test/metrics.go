@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cbr_requests_total",
+		Help: "Total number of CBR HTTP requests, labeled by outcome status.",
+	}, []string{"status"})
+
+	requestDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cbr_request_duration_seconds",
+		Help:    "Duration of CBR HTTP requests in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	latestRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cbr_rate",
+		Help: "Latest known RUB rate for a currency code.",
+	}, []string{"code"})
+
+	// latestRateDate remembers the quote date behind each cbr_rate value,
+	// so a concurrently fetched older date never overwrites a newer one.
+	latestRateMu   sync.Mutex
+	latestRateDate = make(map[string]time.Time)
+)
+
+// observeFetch records the outcome of one getCurrencyData call and, on
+// success, updates the latest-rate gauge for each currency it returned
+// unless the gauge already holds a rate for a later date.
+func observeFetch(date string, start time.Time, records []CurrencyRecord, err error) {
+	requestDuration.Observe(time.Since(start).Seconds())
+	requestsTotal.WithLabelValues(fetchStatusLabel(err)).Inc()
+
+	day, parseErr := time.Parse(cbrDateLayout, date)
+	latestRateMu.Lock()
+	defer latestRateMu.Unlock()
+	for _, r := range records {
+		if parseErr == nil {
+			if day.Before(latestRateDate[r.Code]) {
+				continue
+			}
+			latestRateDate[r.Code] = day
+		}
+		latestRate.WithLabelValues(r.Code).Set(r.Value)
+	}
+}
+
+func fetchStatusLabel(err error) string {
+	if err == nil {
+		return "ok"
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return strconv.Itoa(statusErr.StatusCode)
+	}
+
+	return "error"
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tealeg/xlsx"
+)
+
+// CurrencyStat is the per-currency average derived from CurrencyAggregator,
+// with a stable field ordering for CSV/XLSX export.
+type CurrencyStat struct {
+	Code    string  `json:"code"`
+	Name    string  `json:"name"`
+	Average float64 `json:"average"`
+}
+
+// ReportData is the full result of a run, handed to a Reporter for
+// rendering in whichever output format the user asked for.
+type ReportData struct {
+	Days                 int              `json:"days"`
+	SuccessDays          int              `json:"success_days"`
+	TotalCurrencyRecords int              `json:"total_currency_records"`
+	Base                 string           `json:"base"`
+	MaxRecord            CurrencyRecord   `json:"max_record"`
+	MinRecord            CurrencyRecord   `json:"min_record"`
+	Stats                []CurrencyStat   `json:"stats"`
+	Records              []CurrencyRecord `json:"records"`
+}
+
+// Reporter renders a ReportData to w in a specific output format.
+type Reporter interface {
+	Report(data ReportData, w io.Writer) error
+}
+
+// newReporter resolves the --format flag value to a Reporter.
+func newReporter(format string) (Reporter, error) {
+	switch format {
+	case "", "text":
+		return textReporter{}, nil
+	case "json":
+		return jsonReporter{}, nil
+	case "csv":
+		return csvReporter{}, nil
+	case "xlsx":
+		return xlsxReporter{}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный формат отчета: %s", format)
+	}
+}
+
+// aggregateReport computes min/max/average statistics over records, the
+// same way the original one-shot report did, for use by the report and
+// export subcommands once data lives in the database. records are
+// expected to already be expressed against base (see crossRate).
+func aggregateReport(records []CurrencyRecord, base string) ReportData {
+	stats := make(map[string]CurrencyAggregator)
+	var maxRecord, minRecord CurrencyRecord
+	hasRecords := false
+	seenDates := make(map[string]bool)
+
+	for _, record := range records {
+		if agg, exists := stats[record.Code]; exists {
+			agg.Sum += record.Value
+			agg.Count++
+			stats[record.Code] = agg
+		} else {
+			stats[record.Code] = CurrencyAggregator{
+				Name:  record.Name,
+				Sum:   record.Value,
+				Count: 1,
+			}
+		}
+
+		if !hasRecords || record.Value > maxRecord.Value {
+			maxRecord = record
+		}
+		if !hasRecords || record.Value < minRecord.Value {
+			minRecord = record
+		}
+		hasRecords = true
+		seenDates[record.Date] = true
+	}
+
+	return ReportData{
+		Days:                 dateSpan(seenDates),
+		SuccessDays:          len(seenDates),
+		TotalCurrencyRecords: len(records),
+		Base:                 normalizeBase(base),
+		MaxRecord:            maxRecord,
+		MinRecord:            minRecord,
+		Stats:                buildCurrencyStats(stats),
+		Records:              records,
+	}
+}
+
+// dateSpan returns the number of calendar days between the earliest and
+// latest of dates, inclusive — the width of the date range the report
+// covers, as opposed to SuccessDays which counts only the days CBR
+// actually published data for (e.g. excluding weekends and holidays).
+func dateSpan(dates map[string]bool) int {
+	var earliest, latest time.Time
+	first := true
+
+	for d := range dates {
+		t, err := time.Parse(cbrDateLayout, d)
+		if err != nil {
+			continue
+		}
+		if first || t.Before(earliest) {
+			earliest = t
+		}
+		if first || t.After(latest) {
+			latest = t
+		}
+		first = false
+	}
+
+	if first {
+		return 0
+	}
+	return int(latest.Sub(earliest).Hours()/24) + 1
+}
+
+// buildCurrencyStats converts the aggregation map into a slice sorted by
+// currency code, so JSON/CSV/XLSX output is stable across runs despite
+// Go's randomized map iteration order.
+func buildCurrencyStats(stats map[string]CurrencyAggregator) []CurrencyStat {
+	result := make([]CurrencyStat, 0, len(stats))
+	for code, agg := range stats {
+		result = append(result, CurrencyStat{
+			Code:    code,
+			Name:    agg.Name,
+			Average: agg.Sum / float64(agg.Count),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Code < result[j].Code })
+	return result
+}
+
+// textReporter reproduces the original stdout report.
+type textReporter struct{}
+
+func (textReporter) Report(data ReportData, w io.Writer) error {
+	base := normalizeBase(data.Base)
+	fmt.Fprintf(w, "Базовая валюта: %s\n", base)
+
+	if len(data.Stats) == 0 {
+		_, err := fmt.Fprintln(w, "Не удалось загрузить данные за указанный период.")
+		return err
+	}
+
+	fmt.Fprintf(w, "Обработано всего %d записей о курсах.\n", data.TotalCurrencyRecords)
+
+	fmt.Fprintf(w, "Максимальный курс: %.4f %s за 1 %s (%s)\n",
+		data.MaxRecord.Value, base, data.MaxRecord.Code, data.MaxRecord.Name)
+	fmt.Fprintf(w, "Дата фиксации: %s\n", data.MaxRecord.Date)
+
+	fmt.Fprintf(w, "Минимальный курс: %.4f %s за 1 %s (%s)\n",
+		data.MinRecord.Value, base, data.MinRecord.Code, data.MinRecord.Name)
+	fmt.Fprintf(w, "Дата фиксации: %s\n", data.MinRecord.Date)
+
+	fmt.Fprintf(w, "Количество уникальных валют: %d\n", len(data.Stats))
+
+	fmt.Fprintf(w, "%-6s %-30s %15s\n", "Код", "Название Валюты", fmt.Sprintf("Средний Курс (%s)", base))
+	fmt.Fprintln(w, strings.Repeat("-", 53))
+
+	for _, stat := range data.Stats {
+		fmt.Fprintf(w, "%-6s %-30s %15.4f\n", stat.Code, stat.Name, stat.Average)
+	}
+
+	return nil
+}
+
+type jsonReporter struct{}
+
+func (jsonReporter) Report(data ReportData, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// csvReporter writes the per-currency averages, one row per currency code.
+type csvReporter struct{}
+
+func (csvReporter) Report(data ReportData, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"code", "name", "average"}); err != nil {
+		return err
+	}
+
+	for _, stat := range data.Stats {
+		row := []string{stat.Code, stat.Name, strconv.FormatFloat(stat.Average, 'f', 4, 64)}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return writer.Error()
+}
+
+// xlsxReporter emits a workbook with the per-currency averages on one
+// sheet and the raw daily records on a second, so users can pivot the
+// data themselves.
+type xlsxReporter struct{}
+
+func (xlsxReporter) Report(data ReportData, w io.Writer) error {
+	file := xlsx.NewFile()
+
+	averages, err := file.AddSheet("Averages")
+	if err != nil {
+		return err
+	}
+	averages.AddRow().WriteSlice(&[]string{"Code", "Name", "Average"}, -1)
+	for _, stat := range data.Stats {
+		row := averages.AddRow()
+		row.AddCell().SetString(stat.Code)
+		row.AddCell().SetString(stat.Name)
+		row.AddCell().SetFloat(stat.Average)
+	}
+
+	records, err := file.AddSheet("Daily Records")
+	if err != nil {
+		return err
+	}
+	records.AddRow().WriteSlice(&[]string{"Date", "Code", "Name", "Value"}, -1)
+	for _, rec := range data.Records {
+		row := records.AddRow()
+		row.AddCell().SetString(rec.Date)
+		row.AddCell().SetString(rec.Code)
+		row.AddCell().SetString(rec.Name)
+		row.AddCell().SetFloat(rec.Value)
+	}
+
+	return file.Write(w)
+}
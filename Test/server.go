@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_SERVE_ADDR       = ":8080"
+	DEFAULT_METRICS_ADDR     = ":9090"
+	SCHEDULER_FETCH_DAYS     = 2 // re-check today and yesterday each tick, since CBR may publish late
+	SCHEDULER_FETCH_INTERVAL = time.Hour
+)
+
+// wsRequest is the {action, params} frame clients send over the
+// WebSocket endpoint.
+type wsRequest struct {
+	Action string          `json:"action"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// wsResponse is the frame pushed back to subscribers, either in reply to
+// a request or as an unsolicited broadcast of newly fetched records.
+type wsResponse struct {
+	Action string      `json:"action"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// hub tracks connected WebSocket subscribers and fans out broadcasts.
+// gorilla/websocket allows only one concurrent writer per connection, so
+// each client's writes (its own request replies and hub broadcasts) are
+// serialized through a per-connection mutex.
+type hub struct {
+	mu      sync.Mutex
+	clients map[*websocket.Conn]*sync.Mutex
+}
+
+func newHub() *hub {
+	return &hub{clients: make(map[*websocket.Conn]*sync.Mutex)}
+}
+
+func (h *hub) add(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[conn] = &sync.Mutex{}
+}
+
+func (h *hub) remove(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[conn]; ok {
+		delete(h.clients, conn)
+		conn.Close()
+	}
+}
+
+// writeJSON writes resp to conn, serialized against any other write (a
+// reply or a broadcast) in flight for that same connection.
+func (h *hub) writeJSON(conn *websocket.Conn, resp wsResponse) error {
+	h.mu.Lock()
+	writeMu, ok := h.clients[conn]
+	h.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	return conn.WriteJSON(resp)
+}
+
+func (h *hub) broadcast(resp wsResponse) {
+	h.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(h.clients))
+	for conn := range h.clients {
+		conns = append(conns, conn)
+	}
+	h.mu.Unlock()
+
+	for _, conn := range conns {
+		if err := h.writeJSON(conn, resp); err != nil {
+			h.remove(conn)
+		}
+	}
+}
+
+// server wires the database and WebSocket hub into the HTTP handlers for
+// "serve" mode.
+type server struct {
+	db  *gorm.DB
+	hub *hub
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// runServe starts the "serve" subcommand: an HTTP+WebSocket API over the
+// database, fed by a background scheduler that keeps fetching.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dbPath := fs.String("db", defaultDBPath(), "path to the sqlite database")
+	addr := fs.String("addr", DEFAULT_SERVE_ADDR, "address to listen on")
+	metricsAddr := fs.String("metrics-addr", DEFAULT_METRICS_ADDR, "address to serve /metrics on")
+	cacheDir := fs.String("cache-dir", defaultCacheDir(), "directory for cached CBR daily XML")
+	noCache := fs.Bool("no-cache", false, "bypass the on-disk XML cache")
+	fetchInterval := fs.Duration("fetch-interval", SCHEDULER_FETCH_INTERVAL, "how often the background scheduler checks for new rates")
+	fs.Parse(args)
+
+	db, err := openDB(*dbPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	srv := &server{db: db, hub: newHub()}
+
+	ctx := context.Background()
+	cache := newXMLCache(*cacheDir, *noCache)
+	limiter := rate.NewLimiter(rate.Every(REQUEST_RATE), 1)
+	go srv.runScheduler(ctx, *fetchInterval, cache, limiter)
+
+	go func() {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promhttp.Handler())
+		logger.Info("сервер метрик запущен", zap.String("addr", *metricsAddr))
+		if err := http.ListenAndServe(*metricsAddr, metricsMux); err != nil {
+			logger.Error("ошибка сервера метрик", zap.Error(err))
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rates", srv.handleRates)
+	mux.HandleFunc("/report", srv.handleReport)
+	mux.HandleFunc("/ws", srv.handleWS)
+
+	logger.Info("сервер запущен", zap.String("addr", *addr))
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// handleRates serves GET /rates?code=USD&from=...&to=....
+func (s *server) handleRates(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	records, err := queryRecords(s.db, q.Get("from"), q.Get("to"), q.Get("code"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, records)
+}
+
+// handleReport serves GET /report?days=90, reusing the same aggregation
+// as the report subcommand over the last N days held in the database.
+func (s *server) handleReport(w http.ResponseWriter, r *http.Request) {
+	days := REPORT_DAYS
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "некорректный параметр days", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	dates := generateDates(days)
+	from, to := dates[len(dates)-1], dates[0]
+	base := r.URL.Query().Get("base")
+
+	records, err := queryRecords(s.db, from, to, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, aggregateReport(crossRate(records, records, base), base))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// handleWS upgrades the connection and services {action, params} request
+// frames from the client; the same connection also receives broadcast
+// frames from the background scheduler as new records are fetched.
+func (s *server) handleWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("ошибка апгрейда WebSocket", zap.Error(err))
+		return
+	}
+	s.hub.add(conn)
+	defer s.hub.remove(conn)
+
+	for {
+		var req wsRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		_ = s.hub.writeJSON(conn, s.handleWSRequest(req))
+	}
+}
+
+func (s *server) handleWSRequest(req wsRequest) wsResponse {
+	switch req.Action {
+	case "rates":
+		var params struct {
+			Code string `json:"code"`
+			From string `json:"from"`
+			To   string `json:"to"`
+		}
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				return wsResponse{Action: req.Action, Error: err.Error()}
+			}
+		}
+		records, err := queryRecords(s.db, params.From, params.To, params.Code)
+		if err != nil {
+			return wsResponse{Action: req.Action, Error: err.Error()}
+		}
+		return wsResponse{Action: req.Action, Data: records}
+	default:
+		return wsResponse{Action: req.Action, Error: fmt.Sprintf("неизвестное действие: %s", req.Action)}
+	}
+}
+
+// runScheduler periodically re-fetches the most recent days (CBR may
+// publish today's rate late) and broadcasts any newly stored records to
+// WebSocket subscribers.
+func (s *server) runScheduler(ctx context.Context, interval time.Duration, cache *xmlCache, limiter *rate.Limiter) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.fetchAndBroadcast(ctx, cache, limiter)
+	for range ticker.C {
+		s.fetchAndBroadcast(ctx, cache, limiter)
+	}
+}
+
+func (s *server) fetchAndBroadcast(ctx context.Context, cache *xmlCache, limiter *rate.Limiter) {
+	dates := generateDates(SCHEDULER_FETCH_DAYS)
+
+	before, err := existingRecordKeys(s.db, dates)
+	if err != nil {
+		logger.Error("ошибка чтения имеющихся записей", zap.Error(err))
+		return
+	}
+
+	results := fetchAll(ctx, dates, WORKER_COUNT, limiter, cache)
+
+	var fresh []CurrencyRecord
+	for _, res := range results {
+		if res.err != nil {
+			continue
+		}
+		fresh = append(fresh, res.records...)
+	}
+	if len(fresh) == 0 {
+		return
+	}
+
+	if err := saveRecords(s.db, fresh); err != nil {
+		logger.Error("ошибка сохранения новых данных", zap.Error(err))
+		return
+	}
+
+	// saveRecords silently skips records already in the database, so only
+	// broadcast the ones that weren't there before this tick's fetch —
+	// otherwise already-known rows get re-pushed to subscribers on every
+	// scheduler tick.
+	for _, record := range fresh {
+		if before[recordKey(record)] {
+			continue
+		}
+		s.hub.broadcast(wsResponse{Action: "new_record", Data: record})
+	}
+}